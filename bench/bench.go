@@ -0,0 +1,260 @@
+// Package bench runs reproducible synthetic workloads against codecs.
+package bench
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"h12.me/hdb/codec/raw"
+)
+
+// Codec is a named pair of marshal/unmarshal functions.
+type Codec struct {
+	Name      string
+	Marshal   func(v interface{}) ([]byte, error)
+	Unmarshal func(data []byte, v interface{}) error
+}
+
+var (
+	Gob       = Codec{Name: "gob", Marshal: gobMarshal, Unmarshal: gobUnmarshal}
+	Raw       = Codec{Name: "raw", Marshal: raw.Marshal, Unmarshal: raw.Unmarshal}
+	RawVarint = Codec{Name: "raw-varint", Marshal: raw.MarshalVarint, Unmarshal: raw.UnmarshalVarint}
+)
+
+func gobMarshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func gobUnmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// Distribution draws a non-negative length from r.
+type Distribution func(r *rand.Rand) int
+
+// Fixed always returns n.
+func Fixed(n int) Distribution {
+	return func(*rand.Rand) int { return n }
+}
+
+// Uniform returns lengths evenly spread over [min, max].
+func Uniform(min, max int) Distribution {
+	return func(r *rand.Rand) int { return min + r.Intn(max-min+1) }
+}
+
+// Exponential returns lengths with the given mean, mostly small with a long
+// tail, which is closer to real payloads than a uniform spread.
+func Exponential(mean float64) Distribution {
+	return func(r *rand.Rand) int { return int(r.ExpFloat64() * mean) }
+}
+
+// FieldMix is the number of fields of each kind in a generated record.
+type FieldMix struct {
+	Ints    int
+	Strings int
+	Bytes   int
+}
+
+// Workload describes a synthetic stream of operations. Each operation is a
+// write with probability 1-ReadRatio, or a read of a previously written
+// record otherwise. Runs with the same Seed produce the same records.
+type Workload struct {
+	Seed      int64
+	Ops       int
+	ReadRatio float64
+	Fields    FieldMix
+	Size      Distribution // length of each string and bytes field
+}
+
+// Result summarizes a Run.
+type Result struct {
+	Codec    string
+	Writes   int
+	Reads    int
+	Bytes    int           // total encoded bytes written
+	Duration time.Duration // spent in Marshal and Unmarshal only
+}
+
+// BytesPerRecord returns the average encoded record size.
+func (r Result) BytesPerRecord() float64 {
+	if r.Writes == 0 {
+		return 0
+	}
+	return float64(r.Bytes) / float64(r.Writes)
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%s: %d writes, %d reads, %.1f bytes/record, %v",
+		r.Codec, r.Writes, r.Reads, r.BytesPerRecord(), r.Duration)
+}
+
+// Run executes w against c, verifying that every read decodes back to the
+// record that was written.
+func Run(w Workload, c Codec) (Result, error) {
+	if w.Size == nil {
+		w.Size = Fixed(0)
+	}
+	typ := w.Fields.recordType()
+	rnd := rand.New(rand.NewSource(w.Seed))
+	var (
+		records []reflect.Value
+		encoded [][]byte
+		res     = Result{Codec: c.Name}
+	)
+	for i := 0; i < w.Ops; i++ {
+		if len(records) > 0 && rnd.Float64() < w.ReadRatio {
+			j := rnd.Intn(len(records))
+			v := reflect.New(typ)
+			start := time.Now()
+			err := c.Unmarshal(encoded[j], v.Interface())
+			res.Duration += time.Since(start)
+			if err != nil {
+				return res, err
+			}
+			if !equal(v.Elem(), records[j]) {
+				return res, fmt.Errorf("bench: %s record %d does not round trip", c.Name, j)
+			}
+			res.Reads++
+			continue
+		}
+		v := w.record(rnd, typ)
+		start := time.Now()
+		data, err := c.Marshal(v.Addr().Interface())
+		res.Duration += time.Since(start)
+		if err != nil {
+			return res, err
+		}
+		records = append(records, v)
+		encoded = append(encoded, data)
+		res.Writes++
+		res.Bytes += len(data)
+	}
+	return res, nil
+}
+
+// Records returns n records generated from w.Seed, as pointers ready to be
+// marshaled.
+func (w Workload) Records(n int) []interface{} {
+	if w.Size == nil {
+		w.Size = Fixed(0)
+	}
+	typ := w.Fields.recordType()
+	rnd := rand.New(rand.NewSource(w.Seed))
+	vs := make([]interface{}, n)
+	for i := range vs {
+		vs[i] = w.record(rnd, typ).Addr().Interface()
+	}
+	return vs
+}
+
+// New returns a pointer to an empty record of w, to unmarshal into.
+func (w Workload) New() interface{} {
+	return reflect.New(w.Fields.recordType()).Interface()
+}
+
+// benchRecords is the size of the record set cycled through by Benchmark.
+const benchRecords = 1000
+
+// Benchmark measures c marshaling and unmarshaling a fixed set of records
+// generated from w. Generating the records and checking them are not
+// timed; use Run for correctness.
+func Benchmark(b *testing.B, w Workload, c Codec) {
+	records := w.Records(benchRecords)
+	encoded := make([][]byte, len(records))
+	size := 0
+	for i, v := range records {
+		data, err := c.Marshal(v)
+		if err != nil {
+			b.Fatal(err)
+		}
+		encoded[i] = data
+		size += len(data)
+	}
+	bytesPerRecord := float64(size) / float64(len(records))
+	b.Run("marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := c.Marshal(records[i%len(records)]); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(bytesPerRecord, "bytes/record")
+	})
+	b.Run("unmarshal", func(b *testing.B) {
+		v := w.New()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := c.Unmarshal(encoded[i%len(encoded)], v); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(bytesPerRecord, "bytes/record")
+	})
+}
+
+func (m FieldMix) recordType() reflect.Type {
+	var fields []reflect.StructField
+	add := func(prefix string, n int, t reflect.Type) {
+		for i := 0; i < n; i++ {
+			fields = append(fields, reflect.StructField{
+				Name: fmt.Sprintf("%s%d", prefix, i),
+				Type: t,
+			})
+		}
+	}
+	add("I", m.Ints, reflect.TypeOf(int64(0)))
+	add("S", m.Strings, reflect.TypeOf(""))
+	add("B", m.Bytes, reflect.TypeOf([]byte(nil)))
+	return reflect.StructOf(fields)
+}
+
+func (w Workload) record(r *rand.Rand, typ reflect.Type) reflect.Value {
+	v := reflect.New(typ).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.Int64:
+			// spread evenly over bit lengths so small values are common
+			f.SetInt(r.Int63n(1 << uint(r.Intn(62)+1)))
+		case reflect.String:
+			f.SetString(string(randBytes(r, w.Size(r))))
+		case reflect.Slice:
+			f.SetBytes(randBytes(r, w.Size(r)))
+		}
+	}
+	return v
+}
+
+func randBytes(r *rand.Rand, n int) []byte {
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = letters[r.Intn(len(letters))]
+	}
+	return b
+}
+
+// equal compares two records field by field, treating nil and empty byte
+// slices as equal since codecs differ in which one they decode to.
+func equal(a, b reflect.Value) bool {
+	for i := 0; i < a.NumField(); i++ {
+		fa, fb := a.Field(i), b.Field(i)
+		if fa.Kind() == reflect.Slice {
+			if !bytes.Equal(fa.Bytes(), fb.Bytes()) {
+				return false
+			}
+		} else if fa.Interface() != fb.Interface() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package bench
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testWorkload = Workload{
+	Seed:      1,
+	Ops:       1000,
+	ReadRatio: 0.3,
+	Fields:    FieldMix{Ints: 5, Strings: 2, Bytes: 1},
+	Size:      Uniform(0, 64),
+}
+
+func TestRun(t *testing.T) {
+	for _, c := range []Codec{Gob, Raw, RawVarint} {
+		res, err := Run(testWorkload, c)
+		if err != nil {
+			t.Fatal(c.Name, err)
+		}
+		if res.Writes+res.Reads != testWorkload.Ops || res.Reads == 0 {
+			t.Fatalf("%s: unexpected op counts %v", c.Name, res)
+		}
+	}
+}
+
+func TestReproducible(t *testing.T) {
+	r1, err := Run(testWorkload, Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := Run(testWorkload, Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r1.Writes != r2.Writes || r1.Bytes != r2.Bytes {
+		t.Fatalf("expect %v, got %v", r1, r2)
+	}
+}
+
+func TestRecords(t *testing.T) {
+	vs := testWorkload.Records(10)
+	for _, c := range []Codec{Gob, Raw, RawVarint} {
+		for _, v := range vs {
+			data, err := c.Marshal(v)
+			if err != nil {
+				t.Fatal(c.Name, err)
+			}
+			res := testWorkload.New()
+			if err := c.Unmarshal(data, res); err != nil {
+				t.Fatal(c.Name, err)
+			}
+			if !equal(reflect.ValueOf(res).Elem(), reflect.ValueOf(v).Elem()) {
+				t.Fatalf("%s: expect %v, got %v", c.Name, v, res)
+			}
+		}
+	}
+}
+
+func BenchmarkGob(b *testing.B)       { benchmark(b, Gob) }
+func BenchmarkRaw(b *testing.B)       { benchmark(b, Raw) }
+func BenchmarkRawVarint(b *testing.B) { benchmark(b, RawVarint) }
+
+func benchmark(b *testing.B, c Codec) {
+	Benchmark(b, testWorkload, c)
+}
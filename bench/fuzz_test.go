@@ -0,0 +1,195 @@
+package bench
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"h12.me/hdb/envelope"
+)
+
+type fuzzRecord struct {
+	I int64
+	U uint16
+	F float64
+	S string
+	B []byte
+	T bool
+	E []struct{} // elements that raw encodes as no bytes
+	N struct {
+		S []string
+	}
+}
+
+var envelopeCodecs = map[envelope.Codec]Codec{
+	envelope.Gob:       Gob,
+	envelope.Raw:       Raw,
+	envelope.RawVarint: RawVarint,
+}
+
+// FuzzCodecs checks that every codec round trips the same value, both bare
+// and wrapped in an envelope.
+func FuzzCodecs(f *testing.F) {
+	f.Add(int64(0), uint16(0), 0.0, "", []byte(nil), false, uint8(0), "")
+	f.Add(int64(-1), uint16(65535), 1.5, "a", []byte{0, 1}, true, uint8(3), "b")
+	f.Add(int64(math.MinInt64), uint16(1), math.Inf(-1), "\xff", []byte("xyz"), true, uint8(255), "")
+	f.Fuzz(func(t *testing.T, i int64, u uint16, fl float64, s string, b []byte, tr bool, ne uint8, ns string) {
+		if math.IsNaN(fl) {
+			fl = 0
+		}
+		v := fuzzRecord{I: i, U: u, F: fl, S: s, B: b, T: tr, E: make([]struct{}, ne)}
+		if ns != "" {
+			v.N.S = []string{ns, s}
+		}
+		normalize(&v)
+		for id, c := range envelopeCodecs {
+			payload, err := c.Marshal(&v)
+			if err != nil {
+				t.Fatal(c.Name, err)
+			}
+			var res fuzzRecord
+			if err := c.Unmarshal(payload, &res); err != nil {
+				t.Fatal(c.Name, err)
+			}
+			normalize(&res)
+			if !reflect.DeepEqual(v, res) {
+				t.Fatalf("%s: expect %#v, got %#v", c.Name, v, res)
+			}
+
+			h, p, err := envelope.Unmarshal(envelope.Marshal(envelope.Header{Codec: id}, payload))
+			if err != nil {
+				t.Fatal(c.Name, err)
+			}
+			res = fuzzRecord{}
+			if err := envelopeCodecs[h.Codec].Unmarshal(p, &res); err != nil {
+				t.Fatal(c.Name, err)
+			}
+			normalize(&res)
+			if !reflect.DeepEqual(v, res) {
+				t.Fatalf("%s in envelope: expect %#v, got %#v", c.Name, v, res)
+			}
+		}
+	})
+}
+
+// FuzzUnmarshal feeds arbitrary bytes to the envelope and every codec.
+// Whatever any codec accepts must round trip through all of them, and no
+// codec may accept an empty payload or a cut-off copy of its own output,
+// except that raw accepts a cut between top level fields by design.
+func FuzzUnmarshal(f *testing.F) {
+	seed := fuzzRecord{I: 1, U: 2, S: "ab", B: []byte{3}, E: make([]struct{}, 2)}
+	seed.N.S = []string{"x"}
+	f.Add([]byte{})
+	for id, c := range envelopeCodecs {
+		data, err := c.Marshal(&seed)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+		f.Add(data[:len(data)/2])
+		f.Add(envelope.Marshal(envelope.Header{Codec: id}, data))
+		f.Add(envelope.Marshal(envelope.Header{Codec: id}, nil))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkUnmarshal(t, data)
+		h, p, err := envelope.Unmarshal(data)
+		if err != nil {
+			return
+		}
+		if len(p) > len(data) {
+			t.Fatalf("payload of %d bytes from %d bytes of input", len(p), len(data))
+		}
+		if _, ok := envelopeCodecs[h.Codec]; ok {
+			checkUnmarshal(t, p)
+		}
+	})
+}
+
+// maxEmpty bounds the empty structs of a decoded record that is re-encoded.
+const maxEmpty = 1 << 10
+
+func checkUnmarshal(t *testing.T, data []byte) {
+	for _, c := range envelopeCodecs {
+		var v fuzzRecord
+		err := c.Unmarshal(data, &v)
+		if len(data) == 0 && err == nil {
+			t.Fatalf("%s: accepted an empty payload", c.Name)
+		}
+		if err != nil {
+			continue
+		}
+		if math.IsNaN(v.F) {
+			v.F = 0
+		}
+		if len(v.E) > maxEmpty {
+			// a cheap decode, but gob writes a byte per element
+			continue
+		}
+		normalize(&v)
+		for _, c2 := range envelopeCodecs {
+			checkTruncated(t, c2, v)
+		}
+	}
+}
+
+// checkTruncated checks that c round trips v but rejects every proper
+// prefix of its encoding.
+func checkTruncated(t *testing.T, c Codec, v fuzzRecord) {
+	data, err := c.Marshal(&v)
+	if err != nil {
+		t.Fatal(c.Name, err)
+	}
+	var res fuzzRecord
+	if err := c.Unmarshal(data, &res); err != nil {
+		t.Fatal(c.Name, err)
+	}
+	normalize(&res)
+	if !reflect.DeepEqual(v, res) {
+		t.Fatalf("%s: expect %#v, got %#v", c.Name, v, res)
+	}
+	var boundaries map[int]bool
+	if strings.HasPrefix(c.Name, "raw") {
+		boundaries = fieldBoundaries(t, c, &v)
+	}
+	for i := 0; i < len(data); i++ {
+		if boundaries[i] {
+			continue
+		}
+		var res fuzzRecord
+		if err := c.Unmarshal(data[:i], &res); err == nil {
+			t.Fatalf("%s: accepted %d of %d bytes of %x", c.Name, i, len(data), data)
+		}
+	}
+}
+
+// fieldBoundaries returns the offsets between top level fields of v in the
+// encoding of c.
+func fieldBoundaries(t *testing.T, c Codec, v *fuzzRecord) map[int]bool {
+	rv := reflect.ValueOf(v).Elem()
+	m := make(map[int]bool)
+	n := 0
+	for i := 0; i < rv.NumField()-1; i++ {
+		data, err := c.Marshal(rv.Field(i).Addr().Interface())
+		if err != nil {
+			t.Fatal(c.Name, err)
+		}
+		n += len(data)
+		m[n] = true
+	}
+	return m
+}
+
+// normalize maps empty slices to nil, since gob and raw decode them
+// differently.
+func normalize(v *fuzzRecord) {
+	if len(v.B) == 0 {
+		v.B = nil
+	}
+	if len(v.E) == 0 {
+		v.E = nil
+	}
+	if len(v.N.S) == 0 {
+		v.N.S = nil
+	}
+}
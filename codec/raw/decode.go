@@ -0,0 +1,244 @@
+package raw
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+
+	bin "github.com/alecthomas/binary"
+)
+
+// Decoder is the counterpart of Encoder.
+type Decoder struct {
+	Varint bool // see Encoder.Varint
+
+	r   *byteReader
+	dec *bin.Decoder
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	br := &byteReader{Reader: r}
+	dec := bin.NewDecoder(br)
+	dec.Order = defaultEndian
+	return &Decoder{r: br, dec: dec}
+}
+
+func (d *Decoder) Decode(v interface{}) error {
+	err := d.decode(v, true)
+	if err == errPartial {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// errPartial means the input ended between two fields of the top level
+// struct, which Unmarshal accepts as a record written before fields were
+// appended to the struct.
+var errPartial = errors.New("raw: partial struct")
+
+// decode returns io.EOF only if the input ended before v started, and
+// io.ErrUnexpectedEOF if it ended inside v.
+func (d *Decoder) decode(v interface{}, top bool) (err error) {
+	start := d.r.n
+	defer func() {
+		if err == io.EOF && d.r.n != start {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+	if u, ok := v.(encoding.BinaryUnmarshaler); ok {
+		b, err := d.readBytes()
+		if err != nil {
+			return err
+		}
+		return u.UnmarshalBinary(b)
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if !rv.CanAddr() {
+		return errors.New("raw: can only Decode to pointer type")
+	}
+	switch rv.Kind() {
+	case reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := d.decode(rv.Index(i).Addr().Interface(), false); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := d.readBytes()
+			if err != nil {
+				return err
+			}
+			rv.SetBytes(b)
+			return nil
+		}
+		l, err := binary.ReadUvarint(d.r)
+		if err != nil {
+			return err
+		}
+		// grow as elements arrive rather than trusting the length
+		t := rv.Type()
+		rv.Set(reflect.MakeSlice(t, 0, int(min(l, maxPrealloc))))
+		for i := uint64(0); i < l; i++ {
+			elemStart := d.r.n
+			e := reflect.New(t.Elem())
+			if err := d.decode(e.Interface(), false); err != nil {
+				return err
+			}
+			if d.r.n == elemStart {
+				// Elements that read no bytes cannot bound the length by
+				// the input. Zero size elements are all alike and cost no
+				// memory, so make them at once; any other such length
+				// is corrupt, as Encoder refuses to write it.
+				if t.Elem().Size() == 0 && l <= math.MaxInt {
+					rv.Set(reflect.MakeSlice(t, int(l), int(l)))
+					return nil
+				}
+				return io.ErrUnexpectedEOF
+			}
+			rv.Set(reflect.Append(rv, e.Elem()))
+		}
+	case reflect.String:
+		b, err := d.readBytes()
+		if err != nil {
+			return err
+		}
+		rv.SetString(string(b))
+	case reflect.Struct:
+		fields, err := structFields(rv.Type())
+		if err != nil {
+			return err
+		}
+		for i, f := range fields {
+			fieldStart := d.r.n
+			fv := f.value(rv)
+			if f.fixed > 0 {
+				err = d.decodeFixed(fv, f)
+			} else {
+				err = d.decode(fv.Addr().Interface(), false)
+			}
+			if err == io.EOF && top && i > 0 && d.r.n == fieldStart {
+				return errPartial
+			}
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		l, err := binary.ReadUvarint(d.r)
+		if err != nil {
+			return err
+		}
+		t := rv.Type()
+		rv.Set(reflect.MakeMapWithSize(t, int(min(l, maxPrealloc))))
+		for i := uint64(0); i < l; i++ {
+			entryStart := d.r.n
+			key := reflect.New(t.Key())
+			if err := d.decode(key.Interface(), false); err != nil {
+				return err
+			}
+			val := reflect.New(t.Elem())
+			if err := d.decode(val.Interface(), false); err != nil {
+				return err
+			}
+			rv.SetMapIndex(key.Elem(), val.Elem())
+			// an entry of no bytes has a zero width key, so there can
+			// be only one
+			if d.r.n == entryStart && i+1 < l {
+				return io.ErrUnexpectedEOF
+			}
+		}
+	default:
+		if d.Varint {
+			switch rv.Kind() {
+			case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64:
+				x, err := binary.ReadVarint(d.r)
+				if err != nil {
+					return err
+				}
+				if rv.OverflowInt(x) {
+					return fmt.Errorf("raw: varint %d overflows %s", x, rv.Type())
+				}
+				rv.SetInt(x)
+				return nil
+			case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				x, err := binary.ReadUvarint(d.r)
+				if err != nil {
+					return err
+				}
+				if rv.OverflowUint(x) {
+					return fmt.Errorf("raw: uvarint %d overflows %s", x, rv.Type())
+				}
+				rv.SetUint(x)
+				return nil
+			}
+		}
+		return d.dec.Decode(rv.Addr().Interface())
+	}
+	return nil
+}
+
+// maxPrealloc caps the capacity allocated up front from an encoded length,
+// so a corrupt length fails with an EOF instead of a huge allocation.
+const maxPrealloc = 1024
+
+// readBytes reads a uvarint length and that many bytes.
+func (d *Decoder) readBytes() ([]byte, error) {
+	l, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return nil, err
+	}
+	if l > math.MaxInt64 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	var buf bytes.Buffer
+	buf.Grow(int(min(l, maxPrealloc)))
+	if _, err := io.CopyN(&buf, d.r, int64(l)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeFixed reads a fixed width field. Strings are trimmed of the NUL
+// padding, while byte slices keep the full width.
+func (d *Decoder) decodeFixed(v reflect.Value, f field) error {
+	b := make([]byte, f.fixed)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return err
+	}
+	if v.Kind() == reflect.String {
+		v.SetString(string(bytes.TrimRight(b, "\x00")))
+	} else {
+		v.SetBytes(b)
+	}
+	return nil
+}
+
+// byteReader counts the bytes read, so the decoder can tell whether the
+// input ended between values or inside one.
+type byteReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *byteReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *byteReader) ReadByte() (byte, error) {
+	var buf [1]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, err
+	}
+	return buf[0], nil
+}
@@ -0,0 +1,159 @@
+package raw
+
+import (
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+
+	bin "github.com/alecthomas/binary"
+)
+
+// Encoder walks structs, arrays, slices and maps itself to honor the raw
+// struct tags, and hands everything else to the binary encoder.
+type Encoder struct {
+	// Varint encodes integers wider than a byte as zigzag varints and
+	// unsigned integers as uvarints instead of fixed width big endian. The
+	// Decoder must be set the same way.
+	Varint bool
+
+	w   *countWriter
+	enc *bin.Encoder
+	buf [binary.MaxVarintLen64]byte
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	cw := &countWriter{Writer: w}
+	enc := bin.NewEncoder(cw)
+	enc.Order = defaultEndian
+	return &Encoder{w: cw, enc: enc}
+}
+
+func (e *Encoder) Encode(v interface{}) error {
+	switch v.(type) {
+	case encoding.BinaryMarshaler, []byte:
+		return e.enc.Encode(v)
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := e.Encode(elem(rv.Index(i))); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if err := e.writeUvarint(uint64(rv.Len())); err != nil {
+			return err
+		}
+		for i := 0; i < rv.Len(); i++ {
+			start := e.w.n
+			if err := e.Encode(elem(rv.Index(i))); err != nil {
+				return err
+			}
+			if e.w.n == start {
+				// see Decoder.decode
+				if rv.Type().Elem().Size() == 0 {
+					break
+				}
+				return fmt.Errorf("raw: elements of %s encode to no bytes", rv.Type())
+			}
+		}
+	case reflect.Struct:
+		fields, err := structFields(rv.Type())
+		if err != nil {
+			return err
+		}
+		for _, f := range fields {
+			fv := f.value(rv)
+			if f.fixed > 0 {
+				err = e.encodeFixed(fv, f)
+			} else {
+				err = e.Encode(elem(fv))
+			}
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if err := e.writeUvarint(uint64(rv.Len())); err != nil {
+			return err
+		}
+		for _, key := range rv.MapKeys() {
+			if err := e.Encode(key.Interface()); err != nil {
+				return err
+			}
+			if err := e.Encode(rv.MapIndex(key).Interface()); err != nil {
+				return err
+			}
+		}
+	default:
+		if e.Varint {
+			switch rv.Kind() {
+			case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64:
+				n := binary.PutVarint(e.buf[:], rv.Int())
+				_, err := e.w.Write(e.buf[:n])
+				return err
+			case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				return e.writeUvarint(rv.Uint())
+			}
+		}
+		return e.enc.Encode(rv.Interface())
+	}
+	return nil
+}
+
+func (e *Encoder) encodeFixed(v reflect.Value, f field) error {
+	var b []byte
+	if v.Kind() == reflect.String {
+		b = []byte(v.String())
+	} else {
+		b = v.Bytes()
+	}
+	if len(b) > f.fixed {
+		return fmt.Errorf("raw: %s is %d bytes, longer than its fixed width %d", f.name, len(b), f.fixed)
+	}
+	if _, err := e.w.Write(b); err != nil {
+		return err
+	}
+	_, err := e.w.Write(make([]byte, f.fixed-len(b)))
+	return err
+}
+
+func (e *Encoder) writeUvarint(x uint64) error {
+	n := binary.PutUvarint(e.buf[:], x)
+	_, err := e.w.Write(e.buf[:n])
+	return err
+}
+
+// countWriter counts the bytes written, so the encoder can tell whether a
+// value wrote anything.
+type countWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// elem returns a pointer to v, as the binary encoder does, so that pointer
+// receiver BinaryMarshalers are used, matching the pointer the Decoder
+// unmarshals into. v is copied if it is not addressable and only its
+// pointer is a BinaryMarshaler.
+func elem(v reflect.Value) interface{} {
+	if v.CanAddr() {
+		return v.Addr().Interface()
+	}
+	if reflect.PtrTo(v.Type()).Implements(marshalerType) && !v.Type().Implements(marshalerType) {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		return p.Interface()
+	}
+	return v.Interface()
+}
+
+var marshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
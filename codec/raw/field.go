@@ -0,0 +1,120 @@
+package raw
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// field is an encodable struct field, described by a tag like
+//
+//	raw:"-"           skip the field
+//	raw:"3"           encode the field at position 3
+//	raw:"fixed:16"    encode a string or []byte as exactly 16 bytes
+//	raw:"3,fixed:16"  both
+//
+// If any field of a struct has a position, all encoded fields must have
+// one. Positions only set the order of fields and are not written, so
+// fields may be reordered or appended, but a decoder cannot skip the bytes
+// of a field it no longer declares. To remove a field, replace it with a
+// blank field of the same type and tag, e.g. _ int64 `raw:"1"`, which is
+// written as a zero value and discarded when read. Blank fields without a
+// raw tag are skipped, and so are other unexported fields, which may only
+// be tagged "-".
+type field struct {
+	index int
+	name  string
+	order int
+	fixed int  // 0 if not fixed width
+	blank bool // placeholder for a removed field
+}
+
+// value returns the field of struct v to encode or decode into. A blank
+// field is a fresh zero value, since it cannot be set.
+func (f field) value(v reflect.Value) reflect.Value {
+	if f.blank {
+		return reflect.New(v.Type().Field(f.index).Type).Elem()
+	}
+	return v.Field(f.index)
+}
+
+type structInfo struct {
+	fields []field
+	err    error
+}
+
+var structCache sync.Map // map[reflect.Type]*structInfo
+
+func structFields(t reflect.Type) ([]field, error) {
+	if info, ok := structCache.Load(t); ok {
+		return info.(*structInfo).fields, info.(*structInfo).err
+	}
+	fields, err := parseFields(t)
+	structCache.Store(t, &structInfo{fields: fields, err: err})
+	return fields, err
+}
+
+func parseFields(t reflect.Type) ([]field, error) {
+	var (
+		fields  []field
+		ordered int
+	)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, tagged := sf.Tag.Lookup("raw")
+		blank := sf.Name == "_"
+		if blank && !tagged || tag == "-" {
+			continue
+		}
+		if !blank && sf.PkgPath != "" {
+			if tagged {
+				return nil, fmt.Errorf("raw: unexported field %s.%s has tag %q", t, sf.Name, tag)
+			}
+			continue
+		}
+		f := field{index: i, name: sf.Name, order: -1, blank: blank}
+		for _, opt := range strings.Split(tag, ",") {
+			switch {
+			case opt == "":
+			case strings.HasPrefix(opt, "fixed:"):
+				n, err := strconv.Atoi(strings.TrimPrefix(opt, "fixed:"))
+				if err != nil || n <= 0 {
+					return nil, fmt.Errorf("raw: invalid width in tag %q of %s.%s", tag, t, sf.Name)
+				}
+				if !isBytesOrString(sf.Type) {
+					return nil, fmt.Errorf("raw: fixed width on %s.%s of unsupported type %s", t, sf.Name, sf.Type)
+				}
+				f.fixed = n
+			default:
+				n, err := strconv.Atoi(opt)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("raw: invalid tag %q of %s.%s", tag, t, sf.Name)
+				}
+				f.order = n
+				ordered++
+			}
+		}
+		fields = append(fields, f)
+	}
+	if ordered == 0 {
+		return fields, nil
+	}
+	if ordered != len(fields) {
+		return nil, fmt.Errorf("raw: either all or no fields of %s must have a position", t)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].order < fields[j].order })
+	for i := 1; i < len(fields); i++ {
+		if fields[i].order == fields[i-1].order {
+			return nil, fmt.Errorf("raw: %s.%s and %s.%s have the same position %d",
+				t, fields[i-1].name, t, fields[i].name, fields[i].order)
+		}
+	}
+	return fields, nil
+}
+
+func isBytesOrString(t reflect.Type) bool {
+	return t.Kind() == reflect.String || t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
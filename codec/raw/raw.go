@@ -15,22 +15,37 @@ func Marshal(v interface{}) ([]byte, error) {
 	return buf.Bytes(), err
 }
 
+// Unmarshal decodes b into v. If b ends between two fields of the top level
+// struct, the remaining fields are left unchanged, so records written
+// before fields were appended to a struct still decode. Empty input or
+// input ending inside a value is an io.ErrUnexpectedEOF.
 func Unmarshal(b []byte, v interface{}) error {
-	err := NewDecoder(bytes.NewReader(b)).Decode(v)
-	if err == io.EOF {
-		return nil
-	}
-	return err
+	return unmarshal(NewDecoder(bytes.NewReader(b)), v)
+}
+
+// MarshalVarint is like Marshal with Encoder.Varint set.
+func MarshalVarint(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.Varint = true
+	err := enc.Encode(v)
+	return buf.Bytes(), err
 }
 
-func NewEncoder(w io.Writer) *binary.Encoder {
-	enc := binary.NewEncoder(w)
-	enc.Order = defaultEndian
-	return enc
+// UnmarshalVarint is like Unmarshal with Decoder.Varint set.
+func UnmarshalVarint(b []byte, v interface{}) error {
+	dec := NewDecoder(bytes.NewReader(b))
+	dec.Varint = true
+	return unmarshal(dec, v)
 }
 
-func NewDecoder(r io.Reader) *binary.Decoder {
-	dec := binary.NewDecoder(r)
-	dec.Order = defaultEndian
-	return dec
+func unmarshal(dec *Decoder, v interface{}) error {
+	err := dec.decode(v, true)
+	switch err {
+	case errPartial:
+		return nil
+	case io.EOF:
+		return io.ErrUnexpectedEOF
+	}
+	return err
 }
@@ -2,6 +2,7 @@ package raw
 
 import (
 	"bytes"
+	"io"
 	"reflect"
 	"testing"
 	"time"
@@ -91,3 +92,272 @@ func TestAddRemove(t *testing.T) {
 		}
 	}
 }
+
+func TestTags(t *testing.T) {
+	type s0 struct {
+		A int8   `raw:"2"`
+		B string `raw:"0,fixed:4"`
+		C []byte `raw:"1,fixed:3"`
+		D int8   `raw:"-"`
+	}
+	v := s0{A: 1, B: "ab", C: []byte{1}, D: 2}
+	data, err := Marshal(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{'a', 'b', 0, 0, 1, 0, 0, 1}
+	if !bytes.Equal(data, expected) {
+		t.Fatalf("expect %v, got %v", expected, data)
+	}
+	var res s0
+	if err := Unmarshal(data, &res); err != nil {
+		t.Fatal(err)
+	}
+	v.C, v.D = []byte{1, 0, 0}, 0
+	if !reflect.DeepEqual(v, res) {
+		t.Fatalf("expect %v, got %v", v, res)
+	}
+
+	// reordering fields keeps the layout
+	type s1 struct {
+		C []byte `raw:"1,fixed:3"`
+		A int8   `raw:"2"`
+		B string `raw:"0,fixed:4"`
+	}
+	if data, err := Marshal(s1{A: 1, B: "ab", C: []byte{1}}); err != nil || !bytes.Equal(data, expected) {
+		t.Fatalf("expect %v, got %v, %v", expected, data, err)
+	}
+}
+
+func TestTagErrors(t *testing.T) {
+	for _, v := range []interface{}{
+		struct {
+			A int `raw:"0"`
+			B int
+		}{},
+		struct {
+			A int `raw:"1"`
+			B int `raw:"1"`
+		}{},
+		struct {
+			A int `raw:"fixed:4"`
+		}{},
+		struct {
+			A string `raw:"fixed:x"`
+		}{},
+		struct {
+			A string `raw:"fixed:1"`
+		}{"ab"},
+		struct {
+			a int `raw:"0"`
+		}{},
+	} {
+		if _, err := Marshal(v); err == nil {
+			t.Fatalf("expect error for %#v", v)
+		}
+	}
+}
+
+func TestVarint(t *testing.T) {
+	type s0 struct {
+		A int
+		B int64
+		C uint32
+		D int8
+		E []int16
+		F map[string]uint
+	}
+	v := s0{A: -1, B: 300, C: 1, D: -2, E: []int16{-64, 64}, F: map[string]uint{"a": 128}}
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.Varint = true
+	if err := enc.Encode(&v); err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x1, 0xd8, 0x4, 0x1, 0xfe, 0x2, 0x7f, 0x80, 0x1, 0x1, 0x1, 'a', 0x80, 0x1}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatalf("expect %v, got %v", expected, buf.Bytes())
+	}
+
+	var res s0
+	dec := NewDecoder(&buf)
+	dec.Varint = true
+	if err := dec.Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, res) {
+		t.Fatalf("expect %v, got %v", v, res)
+	}
+
+	// a record written before a field was appended
+	type s1 struct {
+		A int
+		B int64
+	}
+	data, err := MarshalVarint(struct{ A int }{A: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var appended s1
+	if err := UnmarshalVarint(data, &appended); err != nil {
+		t.Fatal(err)
+	}
+	if appended.A != -1 {
+		t.Fatalf("expect -1, got %d", appended.A)
+	}
+	if err := UnmarshalVarint(nil, &appended); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expect %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+
+	// overflow
+	var small struct{ A int16 }
+	dec = NewDecoder(bytes.NewReader([]byte{0x80, 0x80, 0x4}))
+	dec.Varint = true
+	if err := dec.Decode(&small); err == nil {
+		t.Fatal("expect overflow error")
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	type s0 struct {
+		A int16
+		B string
+	}
+	type s1 struct {
+		A int16
+		B string
+		C int16
+	}
+	data, err := Marshal(s0{A: 1, B: "ab"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a record written before C was appended
+	res := s1{C: 3}
+	if err := Unmarshal(data, &res); err != nil {
+		t.Fatal(err)
+	}
+	if expected := (s1{A: 1, B: "ab", C: 3}); res != expected {
+		t.Fatalf("expect %v, got %v", expected, res)
+	}
+
+	// empty or cut inside a field
+	for i := 0; i < len(data); i++ {
+		if i == 2 {
+			continue // between A and B
+		}
+		var res s0
+		if err := Unmarshal(data[:i], &res); err != io.ErrUnexpectedEOF {
+			t.Fatalf("%d: expect %v, got %v", i, io.ErrUnexpectedEOF, err)
+		}
+	}
+
+	// a length beyond the input
+	var s string
+	if err := Unmarshal([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}, &s); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expect %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+
+	// a huge length of elements that read no bytes
+	hugeLen := []byte{0xff, 0xff, 0xff, 0xff, 0x0f}
+	var empty []struct{}
+	if err := Unmarshal(hugeLen, &empty); err != nil || len(empty) != 1<<32-1 {
+		t.Fatalf("expect %d empty structs, got %d, %v", 1<<32-1, len(empty), err)
+	}
+	type skipped struct {
+		A int `raw:"-"`
+	}
+	var ss []skipped
+	if err := Unmarshal(hugeLen, &ss); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expect %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+	if _, err := Marshal([]skipped{{1}}); err == nil {
+		t.Fatal("expect error encoding elements of no bytes")
+	}
+	var m map[struct{}]struct{}
+	if err := Unmarshal(hugeLen, &m); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expect %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestRemoveField(t *testing.T) {
+	type v1 struct {
+		A int16  `raw:"0"`
+		B int16  `raw:"1"`
+		C int16  `raw:"2"`
+		D string `raw:"3,fixed:2"`
+	}
+	type v2 struct {
+		A int16  `raw:"0"`
+		_ int16  `raw:"1"`
+		C int16  `raw:"2"`
+		_ string `raw:"3,fixed:2"`
+		_ int16
+	}
+	data, err := Marshal(v1{1, 2, 3, "d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res v2
+	if err := Unmarshal(data, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.A != 1 || res.C != 3 {
+		t.Fatalf("expect A=1, C=3, got %+v", res)
+	}
+
+	// old readers see the removed fields as zero values
+	data, err = Marshal(v2{A: 1, C: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var old v1
+	if err := Unmarshal(data, &old); err != nil {
+		t.Fatal(err)
+	}
+	if expected := (v1{A: 1, C: 3}); old != expected {
+		t.Fatalf("expect %v, got %v", expected, old)
+	}
+}
+
+// ptrMarshaler only marshals through a pointer, and writes its own bytes
+// rather than those of its fields.
+type ptrMarshaler struct{ A int16 }
+
+func (m *ptrMarshaler) MarshalBinary() ([]byte, error) {
+	return []byte{byte(m.A)}, nil
+}
+
+func (m *ptrMarshaler) UnmarshalBinary(data []byte) error {
+	if len(data) != 1 {
+		return io.ErrUnexpectedEOF
+	}
+	m.A = int16(data[0])
+	return nil
+}
+
+func TestPtrMarshaler(t *testing.T) {
+	type s0 struct {
+		M ptrMarshaler
+		N [1]ptrMarshaler
+	}
+	v := s0{M: ptrMarshaler{1}, N: [1]ptrMarshaler{{2}}}
+	expected := []byte{1, 1, 1, 2}
+	for _, in := range []interface{}{&v, v} {
+		data, err := Marshal(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("expect %v, got %v", expected, data)
+		}
+		var res s0
+		if err := Unmarshal(data, &res); err != nil {
+			t.Fatal(err)
+		}
+		if res != v {
+			t.Fatalf("expect %v, got %v", v, res)
+		}
+	}
+}
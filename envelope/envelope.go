@@ -0,0 +1,246 @@
+// Package envelope reads and writes the header that wraps every stored
+// record, so that any blob identifies the codec and schema version it was
+// written with.
+//
+// The layout is:
+//
+//	magic (2 bytes) | codec (1 byte) | flags (1 byte) | version (uvarint) |
+//	key ID (uvarint, only if Encrypted) | sign key ID (uvarint, only if Signed) |
+//	expiry (varint, only if Expires) | payload | MAC (32 bytes, only if Signed)
+package envelope
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// Magic is the first two bytes of every envelope.
+var Magic = [2]byte{'h', 'd'}
+
+var (
+	ErrMagic     = errors.New("envelope: bad magic")
+	ErrTruncated = errors.New("envelope: truncated header")
+	ErrFlags     = errors.New("envelope: unknown flags")
+	ErrExpired   = errors.New("envelope: record expired")
+)
+
+// Codec identifies the format of the payload.
+type Codec uint8
+
+const (
+	Raw Codec = iota + 1
+	Gob
+	Vgob
+	Colfer
+	RawVarint // raw with varint integers, see raw.MarshalVarint
+)
+
+func (c Codec) String() string {
+	switch c {
+	case Raw:
+		return "raw"
+	case Gob:
+		return "gob"
+	case Vgob:
+		return "vgob"
+	case Colfer:
+		return "colfer"
+	case RawVarint:
+		return "raw-varint"
+	}
+	return "unknown"
+}
+
+// Flags is a bit set describing transforms applied to the payload. The low
+// two bits hold the Compression algorithm.
+type Flags uint8
+
+const (
+	compressionMask Flags = 0x3
+
+	// Encrypted marks a payload encrypted with the key named by
+	// Header.KeyID.
+	Encrypted Flags = 1 << 2
+
+	// Signed marks a record followed by an HMAC-SHA256 made with the key
+	// named by Header.SignKeyID. See Keyring.
+	Signed Flags = 1 << 3
+
+	// Expires marks a record that is no longer valid after
+	// Header.ExpiresAt.
+	Expires Flags = 1 << 4
+
+	// knownFlags are the bits this package understands. Any other bit may
+	// add a header field, so such records are rejected rather than having
+	// that field read as payload.
+	knownFlags = compressionMask | Encrypted | Signed | Expires
+)
+
+// Compression returns the compression algorithm recorded in f.
+func (f Flags) Compression() Compression {
+	return Compression(f & compressionMask)
+}
+
+// WithCompression returns f with its compression algorithm set to c.
+func (f Flags) WithCompression(c Compression) Flags {
+	return f&^compressionMask | Flags(c)&compressionMask
+}
+
+// Compression identifies the algorithm the payload is compressed with.
+type Compression uint8
+
+const (
+	NoCompression Compression = iota
+	Snappy
+	Zstd
+	Flate
+)
+
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case Snappy:
+		return "snappy"
+	case Zstd:
+		return "zstd"
+	case Flate:
+		return "flate"
+	}
+	return "unknown"
+}
+
+// Header is the decoded envelope header.
+type Header struct {
+	Codec   Codec
+	Flags   Flags
+	Version uint   // schema version of the payload
+	KeyID   uint32 // encryption key, only stored if Flags has Encrypted
+
+	SignKeyID uint32 // HMAC key, only stored if Flags has Signed
+	ExpiresAt int64  // Unix seconds, only stored if Flags has Expires
+}
+
+// Expired reports whether the record has a TTL that has passed at now.
+func (h Header) Expired(now time.Time) bool {
+	return h.Flags&Expires != 0 && now.Unix() >= h.ExpiresAt
+}
+
+// WithTTL returns h set to expire ttl after now, rounded up to the second.
+func (h Header) WithTTL(now time.Time, ttl time.Duration) Header {
+	h.Flags |= Expires
+	h.ExpiresAt = now.Add(ttl + time.Second - 1).Unix()
+	return h
+}
+
+const fixedLen = len(Magic) + 2
+
+// Append appends the envelope of h and payload to dst. The Signed flag is
+// cleared, since only Keyring.Marshal appends the MAC it promises.
+func Append(dst []byte, h Header, payload []byte) []byte {
+	return appendEnvelope(dst, unsigned(h), payload)
+}
+
+// Marshal returns the envelope of h and payload, clearing Signed like
+// Append.
+func Marshal(h Header, payload []byte) []byte {
+	return marshal(unsigned(h), payload)
+}
+
+func unsigned(h Header) Header {
+	h.Flags &^= Signed
+	h.SignKeyID = 0
+	return h
+}
+
+func marshal(h Header, payload []byte) []byte {
+	// room for every optional field and the MAC appended by Keyring.Marshal
+	return appendEnvelope(make([]byte, 0, fixedLen+4*binary.MaxVarintLen64+macLen+len(payload)), h, payload)
+}
+
+func appendEnvelope(dst []byte, h Header, payload []byte) []byte {
+	dst = append(dst, Magic[:]...)
+	dst = append(dst, byte(h.Codec), byte(h.Flags))
+	dst = binary.AppendUvarint(dst, uint64(h.Version))
+	if h.Flags&Encrypted != 0 {
+		dst = binary.AppendUvarint(dst, uint64(h.KeyID))
+	}
+	if h.Flags&Signed != 0 {
+		dst = binary.AppendUvarint(dst, uint64(h.SignKeyID))
+	}
+	if h.Flags&Expires != 0 {
+		dst = binary.AppendVarint(dst, h.ExpiresAt)
+	}
+	return append(dst, payload...)
+}
+
+// UnmarshalAt is like Unmarshal, but returns ErrExpired along with the
+// header if the record has expired at now.
+func UnmarshalAt(data []byte, now time.Time) (Header, []byte, error) {
+	h, payload, err := Unmarshal(data)
+	if err != nil {
+		return h, nil, err
+	}
+	if h.Expired(now) {
+		return h, nil, ErrExpired
+	}
+	return h, payload, nil
+}
+
+// Unmarshal decodes the header of data and returns the payload following
+// it. The payload aliases data. The MAC of a signed record is stripped but
+// not verified; use Keyring.Unmarshal for that. Expiry is not checked
+// either; use UnmarshalAt for that.
+func Unmarshal(data []byte) (Header, []byte, error) {
+	var h Header
+	if !Is(data) {
+		return h, nil, ErrMagic
+	}
+	if len(data) < fixedLen {
+		return h, nil, ErrTruncated
+	}
+	h.Codec = Codec(data[2])
+	h.Flags = Flags(data[3])
+	if h.Flags&^knownFlags != 0 {
+		return h, nil, ErrFlags
+	}
+	data = data[fixedLen:]
+	ver, n := binary.Uvarint(data)
+	if n <= 0 {
+		return h, nil, ErrTruncated
+	}
+	h.Version = uint(ver)
+	data = data[n:]
+	if h.Flags&Encrypted != 0 {
+		id, n := binary.Uvarint(data)
+		if n <= 0 || id > math.MaxUint32 {
+			return h, nil, ErrTruncated
+		}
+		h.KeyID = uint32(id)
+		data = data[n:]
+	}
+	if h.Flags&Signed != 0 {
+		id, n := binary.Uvarint(data)
+		if n <= 0 || id > math.MaxUint32 || len(data)-n < macLen {
+			return h, nil, ErrTruncated
+		}
+		h.SignKeyID = uint32(id)
+		data = data[n : len(data)-macLen]
+	}
+	if h.Flags&Expires != 0 {
+		exp, n := binary.Varint(data)
+		if n <= 0 {
+			return h, nil, ErrTruncated
+		}
+		h.ExpiresAt = exp
+		data = data[n:]
+	}
+	return h, data, nil
+}
+
+// Is reports whether data starts with the envelope magic.
+func Is(data []byte) bool {
+	return len(data) >= len(Magic) && data[0] == Magic[0] && data[1] == Magic[1]
+}
@@ -0,0 +1,130 @@
+package envelope
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	h := Header{Codec: Raw, Flags: 0x1, Version: 300}
+	payload := []byte("payload")
+	data := Marshal(h, payload)
+
+	// regression
+	expected := []byte{'h', 'd', 0x1, 0x1, 0xac, 0x2, 'p', 'a', 'y', 'l', 'o', 'a', 'd'}
+	if !bytes.Equal(data, expected) {
+		t.Fatalf("expect %v, got %v", expected, data)
+	}
+
+	res, p, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != h {
+		t.Fatalf("expect %v, got %v", h, res)
+	}
+	if !bytes.Equal(p, payload) {
+		t.Fatalf("expect %q, got %q", payload, p)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	h := Header{
+		Codec:   Gob,
+		Flags:   Encrypted.WithCompression(Zstd),
+		Version: 1,
+		KeyID:   7,
+	}
+	data := Marshal(h, []byte("x"))
+	expected := []byte{'h', 'd', 0x2, 0x6, 0x1, 0x7, 'x'}
+	if !bytes.Equal(data, expected) {
+		t.Fatalf("expect %v, got %v", expected, data)
+	}
+	res, p, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != h || string(p) != "x" {
+		t.Fatalf("expect %v, got %v", h, res)
+	}
+	if c := res.Flags.Compression(); c != Zstd {
+		t.Fatalf("expect %v, got %v", Zstd, c)
+	}
+	if c := res.Flags.WithCompression(NoCompression).Compression(); c != NoCompression {
+		t.Fatalf("expect %v, got %v", NoCompression, c)
+	}
+
+	// key ID is not stored without the Encrypted flag
+	h.Flags = 0
+	if res, _, _ := Unmarshal(Marshal(h, nil)); res.KeyID != 0 {
+		t.Fatalf("expect no key ID, got %d", res.KeyID)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	now := time.Date(2017, 1, 2, 3, 4, 5, 6, time.UTC)
+	k := &Keyring{Current: 1, Keys: map[uint32][]byte{1: []byte("k1")}}
+	h := Header{Codec: Raw}.WithTTL(now, time.Minute)
+	data, err := k.Marshal(h, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _, err := k.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Flags |= Signed
+	h.SignKeyID = 1
+	if res != h {
+		t.Fatalf("expect %v, got %v", h, res)
+	}
+	if res.Expired(now.Add(time.Minute - time.Millisecond)) {
+		t.Fatal("expired too early")
+	}
+	if !res.Expired(now.Add(time.Minute + time.Second)) {
+		t.Fatal("expect expired")
+	}
+	if (Header{}).Expired(now.Add(1000 * time.Hour)) {
+		t.Fatal("record without TTL should never expire")
+	}
+
+	later := now.Add(time.Minute + time.Second)
+	if _, _, err := k.UnmarshalAt(data, now); err != nil {
+		t.Fatalf("expect no error before expiry, got %v", err)
+	}
+	if res, _, err := k.UnmarshalAt(data, later); err != ErrExpired || res != h {
+		t.Fatalf("expect ErrExpired with header %v, got %v, %v", h, res, err)
+	}
+	plain := Marshal(Header{Codec: Raw}.WithTTL(now, time.Minute), []byte("payload"))
+	if _, p, err := UnmarshalAt(plain, now); err != nil || string(p) != "payload" {
+		t.Fatalf("expect payload before expiry, got %q, %v", p, err)
+	}
+	if _, _, err := UnmarshalAt(plain, later); err != ErrExpired {
+		t.Fatalf("expect ErrExpired, got %v", err)
+	}
+	if _, _, err := UnmarshalAt(Marshal(Header{Codec: Raw}, nil), later); err != nil {
+		t.Fatalf("record without TTL should never expire, got %v", err)
+	}
+}
+
+func TestUnmarshalError(t *testing.T) {
+	for _, tc := range []struct {
+		data []byte
+		err  error
+	}{
+		{nil, ErrMagic},
+		{[]byte("xd\x01\x00\x00"), ErrMagic},
+		{[]byte("hd\x01"), ErrTruncated},
+		{[]byte("hd\x01\x00"), ErrTruncated},
+		{[]byte("hd\x01\x00\x80"), ErrTruncated},
+		{[]byte("hd\x01\x04\x01"), ErrTruncated},
+		{[]byte("hd\x01\x10\x01"), ErrTruncated},
+		{[]byte("hd\x01\x08\x01\x01"), ErrTruncated},
+		{[]byte("hd\x01\xe0\x01payload"), ErrFlags},
+	} {
+		if _, _, err := Unmarshal(tc.data); err != tc.err {
+			t.Fatalf("%q: expect %v, got %v", tc.data, tc.err, err)
+		}
+	}
+}
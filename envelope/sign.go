@@ -0,0 +1,77 @@
+package envelope
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"time"
+)
+
+const macLen = sha256.Size
+
+var (
+	ErrSignature  = errors.New("envelope: signature mismatch")
+	ErrUnsigned   = errors.New("envelope: record is not signed")
+	ErrUnknownKey = errors.New("envelope: unknown sign key")
+)
+
+// Keyring holds HMAC keys by ID. Records are signed with the key Current,
+// while older keys are kept so records signed before a rotation still
+// verify.
+type Keyring struct {
+	Current uint32
+	Keys    map[uint32][]byte
+}
+
+// Marshal returns the envelope of h and payload signed with the current
+// key.
+func (k *Keyring) Marshal(h Header, payload []byte) ([]byte, error) {
+	key, ok := k.Keys[k.Current]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	h.Flags |= Signed
+	h.SignKeyID = k.Current
+	data := marshal(h, payload)
+	return appendMAC(data, key, data), nil
+}
+
+// Unmarshal verifies the MAC of data before decoding it like the package
+// level Unmarshal.
+func (k *Keyring) Unmarshal(data []byte) (Header, []byte, error) {
+	h, payload, err := Unmarshal(data)
+	if err != nil {
+		return h, nil, err
+	}
+	if h.Flags&Signed == 0 {
+		return h, nil, ErrUnsigned
+	}
+	key, ok := k.Keys[h.SignKeyID]
+	if !ok {
+		return h, nil, ErrUnknownKey
+	}
+	signed, mac := data[:len(data)-macLen], data[len(data)-macLen:]
+	if !hmac.Equal(mac, appendMAC(nil, key, signed)) {
+		return h, nil, ErrSignature
+	}
+	return h, payload, nil
+}
+
+// UnmarshalAt is like Unmarshal, but returns ErrExpired along with the
+// header if the verified record has expired at now.
+func (k *Keyring) UnmarshalAt(data []byte, now time.Time) (Header, []byte, error) {
+	h, payload, err := k.Unmarshal(data)
+	if err != nil {
+		return h, nil, err
+	}
+	if h.Expired(now) {
+		return h, nil, ErrExpired
+	}
+	return h, payload, nil
+}
+
+func appendMAC(dst, key, data []byte) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write(data)
+	return m.Sum(dst)
+}
@@ -0,0 +1,56 @@
+package envelope
+
+import (
+	"testing"
+)
+
+func TestKeyring(t *testing.T) {
+	k := &Keyring{Current: 1, Keys: map[uint32][]byte{1: []byte("k1")}}
+	h := Header{Codec: Raw, Version: 2}
+	data, err := k.Marshal(h, []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, p, err := k.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SignKeyID != 1 || res.Flags&Signed == 0 || string(p) != "payload" {
+		t.Fatalf("unexpected %v %q", res, p)
+	}
+	if _, p, err := Unmarshal(data); err != nil || string(p) != "payload" {
+		t.Fatalf("expect payload, got %q, %v", p, err)
+	}
+
+	// re-wrapping a signed header drops the signature, not the payload
+	rewrapped := Marshal(res, p)
+	if res, p, err := Unmarshal(rewrapped); err != nil || string(p) != "payload" || res.Flags&Signed != 0 {
+		t.Fatalf("expect unsigned payload, got %v %q, %v", res, p, err)
+	}
+	if _, _, err := k.Unmarshal(rewrapped); err != ErrUnsigned {
+		t.Fatalf("expect %v, got %v", ErrUnsigned, err)
+	}
+
+	// rotation: old records still verify
+	k.Keys[2] = []byte("k2")
+	k.Current = 2
+	if _, _, err := k.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	delete(k.Keys, 1)
+	if _, _, err := k.Unmarshal(data); err != ErrUnknownKey {
+		t.Fatalf("expect %v, got %v", ErrUnknownKey, err)
+	}
+
+	// tamper
+	k.Keys[1] = []byte("k1")
+	data[len(data)-macLen-1] ^= 1
+	if _, _, err := k.Unmarshal(data); err != ErrSignature {
+		t.Fatalf("expect %v, got %v", ErrSignature, err)
+	}
+
+	if _, _, err := k.Unmarshal(Marshal(h, nil)); err != ErrUnsigned {
+		t.Fatalf("expect %v, got %v", ErrUnsigned, err)
+	}
+}
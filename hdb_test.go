@@ -2,11 +2,10 @@ package hdb
 
 import (
 	"bytes"
-	"encoding/binary"
 	"encoding/gob"
-	"fmt"
 	"testing"
 
+	"h12.me/hdb/bench"
 	"h12.me/hdb/colfer"
 )
 
@@ -27,28 +26,42 @@ var (
 	}
 )
 
-func TestGob(t *testing.T) {
+func BenchmarkGob(b *testing.B) {
 	w := new(bytes.Buffer)
 	enc := gob.NewEncoder(w)
 	if err := enc.Encode(testValue); err != nil {
-		t.Fatal(err)
+		b.Fatal(err)
 	}
-	l := w.Len()
-	if err := enc.Encode(testValue); err != nil {
-		t.Fatal(err)
+	// measure the steady state, after the type has been sent once
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Reset()
+		if err := enc.Encode(testValue); err != nil {
+			b.Fatal(err)
+		}
 	}
-	fmt.Println(w.Len() - l)
+	b.ReportMetric(float64(w.Len()), "bytes/record")
 }
 
-func TestColfer(t *testing.T) {
-	l, err := testColferValue.MarshalLen()
-	if err != nil {
-		t.Fatal(err)
+func BenchmarkColfer(b *testing.B) {
+	var data []byte
+	for i := 0; i < b.N; i++ {
+		var err error
+		data, err = testColferValue.MarshalBinary()
+		if err != nil {
+			b.Fatal(err)
+		}
 	}
-	fmt.Println(l)
+	b.ReportMetric(float64(len(data)), "bytes/record")
 }
 
-func TestVariantInt(t *testing.T) {
-	l := binary.PutUvarint(make([]byte, 10), 5)
-	fmt.Println(l)
+func BenchmarkWorkload(b *testing.B) {
+	for _, c := range []bench.Codec{bench.Gob, bench.Raw} {
+		b.Run(c.Name, func(b *testing.B) {
+			bench.Benchmark(b, bench.Workload{
+				Seed:   1,
+				Fields: bench.FieldMix{Ints: 25},
+			}, c)
+		})
+	}
 }